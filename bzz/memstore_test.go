@@ -0,0 +1,74 @@
+package bzz
+
+import "testing"
+
+func TestMemStorePutGet(t *testing.T) {
+	s := &dpaMemStorage{}
+	s.Init()
+
+	chunk := &Chunk{Key: Key([]byte{1, 2, 3})}
+	if err := s.Put(chunk); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, ok := s.Get(chunk.Key)
+	if !ok {
+		t.Fatalf("expected a hit for a just-stored chunk")
+	}
+	if got != chunk {
+		t.Errorf("expected Get to return the exact chunk that was stored")
+	}
+
+	if _, ok := s.Get(Key([]byte{9, 9, 9})); ok {
+		t.Errorf("expected a miss for a key that was never stored")
+	}
+}
+
+func TestMemStoreEvictsOldestOnOverflow(t *testing.T) {
+	s := &dpaMemStorage{capacity: 2}
+	s.Init()
+
+	a := &Chunk{Key: Key([]byte{1})}
+	b := &Chunk{Key: Key([]byte{2})}
+	c := &Chunk{Key: Key([]byte{3})}
+
+	s.Put(a)
+	s.Put(b)
+	s.Put(c) // capacity is 2: a, the oldest entry, should be evicted
+
+	if _, ok := s.Get(a.Key); ok {
+		t.Errorf("expected the oldest entry to have been evicted")
+	}
+	if _, ok := s.Get(b.Key); !ok {
+		t.Errorf("expected b to still be cached")
+	}
+	if _, ok := s.Get(c.Key); !ok {
+		t.Errorf("expected c to still be cached")
+	}
+}
+
+func TestMemStoreGetPromotesAfterForceUpdateThreshold(t *testing.T) {
+	s := &dpaMemStorage{capacity: 2}
+	s.Init()
+
+	a := &Chunk{Key: Key([]byte{1})}
+	b := &Chunk{Key: Key([]byte{2})}
+	s.Put(a)
+	s.Put(b)
+
+	// drive enough hits on a to cross dbForceUpdateAccessCnt and force a
+	// re-splice to the front of the LRU list
+	for i := 0; i < dbForceUpdateAccessCnt+1; i++ {
+		s.Get(a.Key)
+	}
+
+	c := &Chunk{Key: Key([]byte{3})}
+	s.Put(c) // b is now the least recently used and should be evicted
+
+	if _, ok := s.Get(b.Key); ok {
+		t.Errorf("expected b to have been evicted once a was promoted ahead of it")
+	}
+	if _, ok := s.Get(a.Key); !ok {
+		t.Errorf("expected a to still be cached after being promoted")
+	}
+}
@@ -0,0 +1,93 @@
+package kademlia
+
+import "fmt"
+
+// AddressLength is the fixed length, in bytes, of a Kademlia address.
+const AddressLength = 32
+
+// Address is the 256 bit identifier used both as a node's position in the
+// Kademlia address space and as a content address for chunk routing. It is
+// a fixed-size array (not a slice) so it can be used directly as a map key
+// and compared with ==, which kaddb's indexes and the routing table's
+// bucket lookups both rely on.
+type Address [AddressLength]byte
+
+// BytesToAddress converts b to an Address, truncating or zero-padding as
+// needed so callers (eg. hive.go's enode/hex parsing, LevelDBStore's key
+// decoding) never have to reach into the array directly.
+func BytesToAddress(b []byte) Address {
+	var addr Address
+	copy(addr[:], b)
+	return addr
+}
+
+// Bytes returns addr's underlying bytes as a slice, for callers (eg.
+// LevelDBStore) that need to embed an address in a []byte key.
+func (addr Address) Bytes() []byte {
+	return addr[:]
+}
+
+func (addr Address) String() string {
+	return fmt.Sprintf("%x", addr[:])
+}
+
+// ProxCmp compares the distance of a and b from target (the receiver),
+// returning -1 if a is closer, 1 if b is closer and 0 if they are
+// equidistant. It establishes the closest-first ordering used by the
+// routing table and by iterative lookups' shortlists.
+func (target Address) ProxCmp(a, b Address) int {
+	for i := range target {
+		da := a[i] ^ target[i]
+		db := b[i] ^ target[i]
+		if da != db {
+			if da < db {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// proximity returns the proximity order of one relative to other: the
+// number of leading bits the two addresses share, ie. the index of the
+// bin one falls into in a table based at other. See the doc comment on
+// Kademlia.proximityBin for the rationale.
+func proximity(one, other Address) (ret int) {
+	for i := range one {
+		diff := one[i] ^ other[i]
+		if diff == 0 {
+			ret += 8
+			continue
+		}
+		for j := 0; j < 8; j++ {
+			if diff&(0x80>>uint(j)) != 0 {
+				return ret + j
+			}
+		}
+	}
+	return ret
+}
+
+// KeyRange returns the [start, stop] address range covering the proximity
+// bin other falls into relative to self, clamped to proxLimit - the range
+// a chunk store would iterate to serve that bin's content.
+func KeyRange(self, other Address, proxLimit int) (start, stop Address) {
+	prox := proximity(self, other)
+	if prox > proxLimit {
+		prox = proxLimit
+	}
+	start, stop = other, other
+	byteIndex, bitIndex := prox/8, uint(prox%8)
+	if byteIndex >= AddressLength {
+		return start, stop
+	}
+	mask := byte(0xff) >> bitIndex
+	start[byteIndex] &^= mask
+	stop[byteIndex] |= mask
+	for i := byteIndex + 1; i < AddressLength; i++ {
+		start[i] = 0
+		stop[i] = 0xff
+	}
+	return start, stop
+}
@@ -0,0 +1,132 @@
+package kademlia
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/logger"
+	"github.com/ethereum/go-ethereum/logger/glog"
+)
+
+// Pinger is the liveness check a Kademlia table performs on a peer before
+// promoting it into an active bucket, and periodically thereafter via
+// Revalidate. It mirrors the ping/pong bonding p2p/discover uses to keep
+// its table honest.
+type Pinger interface {
+	Ping(node Node) error
+}
+
+// SetPinger wires the liveness check used to bond peers. Until it is set,
+// On promotes nodes unconditionally, as before.
+func (self *Kademlia) SetPinger(pinger Pinger) {
+	self.pinger = pinger
+}
+
+// bondCache remembers recently bonded addresses so a burst of On calls for
+// the same peer does not re-ping it every time.
+type bondCache struct {
+	lock sync.Mutex
+	seen map[Address]time.Time
+}
+
+func newBondCache() *bondCache {
+	return &bondCache{seen: make(map[Address]time.Time)}
+}
+
+func (c *bondCache) isFresh(addr Address, timeout time.Duration) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	seenAt, ok := c.seen[addr]
+	return ok && time.Since(seenAt) < timeout
+}
+
+func (c *bondCache) touch(addr Address) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.seen[addr] = time.Now()
+}
+
+// bond proves node is reachable before it may be promoted into an active
+// bucket, reusing a recent successful ping from the bond cache when
+// possible. It is a no-op (always succeeds) if no Pinger has been set,
+// which keeps the zero value of Kademlia backwards compatible.
+func (self *Kademlia) bond(node Node) error {
+	if self.pinger == nil {
+		return nil
+	}
+	if self.bonds.isFresh(node.Addr(), self.BondTimeout) {
+		return nil
+	}
+	if err := self.pinger.Ping(node); err != nil {
+		return err
+	}
+	self.bonds.touch(node.Addr())
+	return nil
+}
+
+// Revalidate starts a background goroutine that, every maxIdleInterval,
+// re-pings the least recently active node of every bucket and evicts it via
+// Off if it fails to respond, topping the bucket back up from the first
+// disconnected kaddb record in that bin that still has a Node set (see
+// replaceFromDb). It runs until quit is closed.
+func (self *Kademlia) Revalidate(quit chan bool) {
+	if self.pinger == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(maxIdleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				self.revalidate()
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+func (self *Kademlia) revalidate() {
+	self.lock.RLock()
+	stale := make([]Node, 0, len(self.buckets))
+	for _, b := range self.buckets {
+		b.lock.RLock()
+		if n := leastRecentlyActive(b.nodes); n != nil {
+			stale = append(stale, n)
+		}
+		b.lock.RUnlock()
+	}
+	self.lock.RUnlock()
+
+	for _, node := range stale {
+		if err := self.pinger.Ping(node); err != nil {
+			glog.V(logger.Debug).Infof("[KΛÐ]: revalidation ping to %v failed, evicting: %v", node.Addr(), err)
+			bin := self.proximityBin(node.Addr())
+			self.Off(node, nil)
+			self.events.send(NodeEvent{Kind: NodeEventEvicted, Node: node, Bin: bin})
+			self.replaceFromDb(node.Addr())
+			continue
+		}
+		self.bonds.touch(node.Addr())
+	}
+}
+
+func leastRecentlyActive(nodes []Node) (oldest Node) {
+	for _, n := range nodes {
+		if oldest == nil || n.LastActive().Before(oldest.LastActive()) {
+			oldest = n
+		}
+	}
+	return oldest
+}
+
+// replaceFromDb looks for a free (currently disconnected) record from
+// kaddb in the bin addr belongs to and feeds its node back through On, so
+// an eviction does not leave the bucket permanently short.
+func (self *Kademlia) replaceFromDb(addr Address) {
+	bin := self.proximityBin(addr)
+	if node, found := self.db.firstDisconnected(bin); found {
+		self.On(node, nil)
+	}
+}
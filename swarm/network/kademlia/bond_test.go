@@ -0,0 +1,88 @@
+package kademlia
+
+import "testing"
+
+// fakePinger answers Ping for a fixed set of addresses configured to fail,
+// and counts how many times it was called.
+type fakePinger struct {
+	fail  map[Address]bool
+	calls int
+}
+
+func (p *fakePinger) Ping(node Node) error {
+	p.calls++
+	if p.fail[node.Addr()] {
+		return errTimeout
+	}
+	return nil
+}
+
+func TestOnRejectsUnbondedNode(t *testing.T) {
+	kad := New(testAddr(0x00), NewKadParams())
+	bad := &fakeNode{addr: testAddr(0x10), url: "bad"}
+	kad.SetPinger(&fakePinger{fail: map[Address]bool{bad.addr: true}})
+
+	if err := kad.On(bad, nil); err == nil {
+		t.Fatalf("expected On to refuse a node that fails to bond")
+	}
+	if kad.Count() != 0 {
+		t.Errorf("an unbonded node must not be counted as active, got count=%d", kad.Count())
+	}
+
+	// the record must still have been written to kaddb - unbonded peers
+	// stay in kaddb, they just don't count toward the active table
+	if kad.DBCount() != 1 {
+		t.Fatalf("expected the unbonded node to still be recorded in kaddb, got DBCount=%d", kad.DBCount())
+	}
+	record, ok := kad.db.get(bad.Addr())
+	if !ok {
+		t.Fatalf("expected to find a kaddb record for the unbonded node")
+	}
+	if record.connected {
+		t.Errorf("an unbonded node's record must not be marked connected")
+	}
+}
+
+func TestOnReusesFreshBond(t *testing.T) {
+	kad := New(testAddr(0x00), NewKadParams())
+	good := &fakeNode{addr: testAddr(0x10), url: "good"}
+	pinger := &fakePinger{fail: map[Address]bool{}}
+	kad.SetPinger(pinger)
+
+	if err := kad.On(good, nil); err != nil {
+		t.Fatalf("On: %v", err)
+	}
+	if pinger.calls != 1 {
+		t.Fatalf("expected exactly one ping, got %d", pinger.calls)
+	}
+
+	// re-seeing the same node within BondTimeout must reuse the cached
+	// bond rather than pinging again
+	if err := kad.On(good, nil); err != nil {
+		t.Fatalf("On (re-seen): %v", err)
+	}
+	if pinger.calls != 1 {
+		t.Errorf("expected the bond cache to avoid a second ping, got %d pings", pinger.calls)
+	}
+}
+
+func TestReplaceFromDbReusesPreviouslyBondedNode(t *testing.T) {
+	kad := New(testAddr(0x00), NewKadParams())
+	node := &fakeNode{addr: testAddr(0x10), url: "node"}
+	kad.SetPinger(&fakePinger{fail: map[Address]bool{}})
+
+	if err := kad.On(node, nil); err != nil {
+		t.Fatalf("On: %v", err)
+	}
+	kad.Off(node, nil)
+	if kad.Count() != 0 {
+		t.Fatalf("expected node to be removed from the active table, count=%d", kad.Count())
+	}
+
+	// Off must keep the record's last known Node around so a revalidation
+	// eviction elsewhere in the same bin can hand it straight back to On
+	kad.replaceFromDb(node.Addr())
+	if kad.Count() != 1 {
+		t.Errorf("expected replaceFromDb to bring the previously bonded node back, count=%d", kad.Count())
+	}
+}
@@ -0,0 +1,97 @@
+package kademlia
+
+import "sync"
+
+// NodeEventKind enumerates the topology changes a Kademlia table fans out
+// to its subscribers.
+type NodeEventKind int
+
+const (
+	NodeEventAdded NodeEventKind = iota
+	NodeEventRemoved
+	NodeEventBonded
+	NodeEventEvicted
+)
+
+func (k NodeEventKind) String() string {
+	switch k {
+	case NodeEventAdded:
+		return "added"
+	case NodeEventRemoved:
+		return "removed"
+	case NodeEventBonded:
+		return "bonded"
+	case NodeEventEvicted:
+		return "evicted"
+	default:
+		return "unknown"
+	}
+}
+
+// NodeEvent is sent to subscribers of SubscribeNodeEvents whenever the
+// routing table adds, removes, bonds or evicts a node.
+type NodeEvent struct {
+	Kind NodeEventKind
+	Node Node
+	Bin  int
+}
+
+// Subscription represents a live SubscribeNodeEvents registration.
+// Unsubscribe is the only safe way to stop reading from the channel that
+// was passed in.
+type Subscription interface {
+	Unsubscribe()
+}
+
+// nodeEventFeed fans NodeEvents out to subscribers under its own lock so a
+// slow or stuck consumer cannot stall On/Off/Revalidate, which hold the
+// table's own lock.
+type nodeEventFeed struct {
+	lock sync.Mutex
+	subs map[*nodeEventSub]struct{}
+}
+
+type nodeEventSub struct {
+	feed *nodeEventFeed
+	ch   chan<- NodeEvent
+}
+
+func newNodeEventFeed() *nodeEventFeed {
+	return &nodeEventFeed{subs: make(map[*nodeEventSub]struct{})}
+}
+
+func (f *nodeEventFeed) subscribe(ch chan<- NodeEvent) Subscription {
+	sub := &nodeEventSub{feed: f, ch: ch}
+	f.lock.Lock()
+	f.subs[sub] = struct{}{}
+	f.lock.Unlock()
+	return sub
+}
+
+func (sub *nodeEventSub) Unsubscribe() {
+	sub.feed.lock.Lock()
+	delete(sub.feed.subs, sub)
+	sub.feed.lock.Unlock()
+}
+
+// send delivers ev to every live subscriber, best effort: a subscriber
+// that isn't draining its channel has the event dropped rather than
+// blocking the sender.
+func (f *nodeEventFeed) send(ev NodeEvent) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for sub := range f.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+// SubscribeNodeEvents registers ch to receive a NodeEvent for every Added,
+// Removed, Bonded and Evicted transition the table makes, letting higher
+// layers (hive, stream managers) react to topology changes without
+// polling String().
+func (self *Kademlia) SubscribeNodeEvents(ch chan<- NodeEvent) Subscription {
+	return self.events.subscribe(ch)
+}
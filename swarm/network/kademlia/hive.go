@@ -0,0 +1,171 @@
+package kademlia
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Hive wraps a Kademlia table and exposes it over rpc.Server under the
+// "kad" namespace, the overlay-topology equivalent of what admin_peers
+// gives operators for devp2p, without having to scrape the ascii
+// Kademlia.String() dump.
+type Hive struct {
+	kad *Kademlia
+}
+
+// NewHive wraps kad for RPC registration.
+func NewHive(kad *Kademlia) *Hive {
+	return &Hive{kad: kad}
+}
+
+// RegisterOn registers the Hive's RPC methods (kad_peers, kad_records,
+// kad_proximity, kad_findClosest, kad_addPeer) under the "kad" namespace.
+func (self *Hive) RegisterOn(server *rpc.Server) error {
+	return server.RegisterName("kad", self)
+}
+
+// PeerInfo is the kad_peers view of one active node.
+type PeerInfo struct {
+	Addr       string    `json:"address"`
+	Url        string    `json:"url"`
+	LastActive time.Time `json:"lastActive"`
+	Bin        int       `json:"bin"`
+}
+
+// Peers dumps the active peers of every bucket.
+func (self *Hive) Peers() []PeerInfo {
+	kad := self.kad
+	kad.lock.RLock()
+	defer kad.lock.RUnlock()
+
+	var peers []PeerInfo
+	for bin, b := range kad.buckets {
+		b.lock.RLock()
+		for _, node := range b.nodes {
+			peers = append(peers, PeerInfo{
+				Addr:       node.Addr().String(),
+				Url:        node.Url(),
+				LastActive: node.LastActive(),
+				Bin:        bin,
+			})
+		}
+		b.lock.RUnlock()
+	}
+	return peers
+}
+
+// RecordInfo is the kad_records view of one kaddb entry.
+type RecordInfo struct {
+	Addr      string    `json:"address"`
+	Url       string    `json:"url"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Retries   int       `json:"retries"`
+	Connected bool      `json:"connected"`
+	Bin       int       `json:"bin"`
+}
+
+// Records dumps every kaddb entry, connected or not, across all bins.
+func (self *Hive) Records() []RecordInfo {
+	db := self.kad.db
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var records []RecordInfo
+	for bin, bucket := range db.Nodes {
+		for _, r := range bucket {
+			records = append(records, RecordInfo{
+				Addr:      r.Addr.String(),
+				Url:       r.Url,
+				LastSeen:  r.LastSeen,
+				Retries:   r.Retries,
+				Connected: r.connected,
+				Bin:       bin,
+			})
+		}
+	}
+	return records
+}
+
+// ProximityInfo is the kad_proximity view of the table's overall shape.
+type ProximityInfo struct {
+	ProxLimit  int `json:"proxLimit"`
+	ProxSize   int `json:"proxSize"`
+	MaxProx    int `json:"maxProx"`
+	BucketSize int `json:"bucketSize"`
+}
+
+// Proximity reports proxLimit, proxSize, MaxProx and BucketSize.
+func (self *Hive) Proximity() ProximityInfo {
+	kad := self.kad
+	kad.lock.RLock()
+	defer kad.lock.RUnlock()
+	return ProximityInfo{
+		ProxLimit:  kad.proxLimit,
+		ProxSize:   kad.proxSize,
+		MaxProx:    kad.MaxProx,
+		BucketSize: kad.BucketSize,
+	}
+}
+
+// FindClosest returns up to max locally known nodes closest to target, a
+// hex-encoded address.
+func (self *Hive) FindClosest(target string, max int) ([]PeerInfo, error) {
+	addr, err := parseAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	nodes := self.kad.FindClosest(addr, max)
+	peers := make([]PeerInfo, len(nodes))
+	for i, n := range nodes {
+		peers[i] = PeerInfo{Addr: n.Addr().String(), Url: n.Url(), LastActive: n.LastActive()}
+	}
+	return peers, nil
+}
+
+// AddPeer parses an enode-style URL (enode://<hex node id>@host:port) into
+// an Address and feeds it into kaddb via Kademlia.Add.
+func (self *Hive) AddPeer(url string) error {
+	addr, err := addressFromEnodeURL(url)
+	if err != nil {
+		return err
+	}
+	self.kad.Add([]*NodeRecord{{Addr: addr, Url: url, LastSeen: time.Now()}})
+	return nil
+}
+
+func addressFromEnodeURL(rawurl string) (Address, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid enode URL %q: %v", rawurl, err)
+	}
+	if u.Scheme != "enode" {
+		return Address{}, fmt.Errorf("invalid enode URL %q: missing enode:// scheme", rawurl)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return Address{}, fmt.Errorf("invalid enode URL %q: missing node id", rawurl)
+	}
+	id, err := hex.DecodeString(u.User.Username())
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid enode URL %q: %v", rawurl, err)
+	}
+	if len(id) != AddressLength {
+		return Address{}, fmt.Errorf("invalid enode URL %q: node id must be %d bytes, got %d", rawurl, AddressLength, len(id))
+	}
+	return BytesToAddress(id), nil
+}
+
+func parseAddress(hexAddr string) (Address, error) {
+	id, err := hex.DecodeString(strings.TrimPrefix(hexAddr, "0x"))
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid address %q: %v", hexAddr, err)
+	}
+	if len(id) != AddressLength {
+		return Address{}, fmt.Errorf("invalid address %q: must be %d bytes, got %d", hexAddr, AddressLength, len(id))
+	}
+	return BytesToAddress(id), nil
+}
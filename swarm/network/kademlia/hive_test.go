@@ -0,0 +1,73 @@
+package kademlia
+
+import "testing"
+
+func TestAddressFromEnodeURL(t *testing.T) {
+	id := "1011120000000000000000000000000000000000000000000000000000000000"
+	addr, err := addressFromEnodeURL("enode://" + id + "@127.0.0.1:30303")
+	if err != nil {
+		t.Fatalf("addressFromEnodeURL: %v", err)
+	}
+	want := testAddr(0x10)
+	want[1], want[2] = 0x11, 0x12
+	if addr != want {
+		t.Errorf("got address %v, want %v", addr, want)
+	}
+}
+
+func TestAddressFromEnodeURLRejectsBadScheme(t *testing.T) {
+	if _, err := addressFromEnodeURL("http://127.0.0.1:30303"); err == nil {
+		t.Fatalf("expected an error for a non-enode:// scheme")
+	}
+}
+
+func TestAddressFromEnodeURLRejectsMissingNodeId(t *testing.T) {
+	if _, err := addressFromEnodeURL("enode://@127.0.0.1:30303"); err == nil {
+		t.Fatalf("expected an error for a missing node id")
+	}
+}
+
+func TestAddressFromEnodeURLRejectsBadHex(t *testing.T) {
+	if _, err := addressFromEnodeURL("enode://nothex@127.0.0.1:30303"); err == nil {
+		t.Fatalf("expected an error for a non-hex node id")
+	}
+}
+
+func TestAddressFromEnodeURLRejectsWrongLength(t *testing.T) {
+	if _, err := addressFromEnodeURL("enode://1011@127.0.0.1:30303"); err == nil {
+		t.Fatalf("expected an error for a node id that isn't AddressLength bytes")
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	hex := "1000000000000000000000000000000000000000000000000000000000000000"
+	addr, err := parseAddress(hex)
+	if err != nil {
+		t.Fatalf("parseAddress: %v", err)
+	}
+	if addr != testAddr(0x10) {
+		t.Errorf("got address %v, want %v", addr, testAddr(0x10))
+	}
+
+	// a leading 0x prefix, as a user would type on a JSON-RPC console,
+	// must be accepted too
+	addrWithPrefix, err := parseAddress("0x" + hex)
+	if err != nil {
+		t.Fatalf("parseAddress with 0x prefix: %v", err)
+	}
+	if addrWithPrefix != addr {
+		t.Errorf("0x-prefixed and bare hex must parse to the same address")
+	}
+}
+
+func TestParseAddressRejectsBadHex(t *testing.T) {
+	if _, err := parseAddress("nothex"); err == nil {
+		t.Fatalf("expected an error for non-hex input")
+	}
+}
+
+func TestParseAddressRejectsWrongLength(t *testing.T) {
+	if _, err := parseAddress("1011"); err == nil {
+		t.Fatalf("expected an error for a hex string that isn't AddressLength bytes")
+	}
+}
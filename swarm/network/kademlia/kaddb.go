@@ -0,0 +1,298 @@
+package kademlia
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// NodeRecord is a persistable record of a known node, bonded or not. It is
+// kept around in kaddb even when the node is currently disconnected, so the
+// table has somewhere to turn once a bucket needs topping back up.
+type NodeRecord struct {
+	Addr     Address   `json:"address"`
+	Url      string    `json:"url"`
+	LastSeen time.Time `json:"lastSeen"`
+	Retries  int       `json:"retries"`
+
+	node      Node
+	connected bool
+}
+
+func (self *NodeRecord) String() string {
+	return fmt.Sprintf("<%v> %v", self.Addr, self.Url)
+}
+
+func (self *NodeRecord) setSeen() {
+	self.LastSeen = time.Now()
+	self.Retries = 0
+}
+
+// RecordStore persists NodeRecords on behalf of KadDb. Implementations
+// back the in-memory index incrementally so a node can restart with a warm
+// kaddb instead of rebuilding it from scratch. IterateBin should visit
+// records within a bin ordered from most to least recently seen.
+type RecordStore interface {
+	Put(record *NodeRecord)
+	Get(addr Address) (*NodeRecord, bool)
+	Delete(addr Address)
+	IterateBin(bin int, fn func(*NodeRecord) bool)
+}
+
+// KadDb is the node record database backing a Kademlia table. The full set
+// of records is kept in memory, indexed by address and grouped by
+// proximity bin, for fast lookup by the table; a RecordStore, if wired via
+// SetStore, is written through to so the table survives a restart.
+type KadDb struct {
+	addr   Address
+	params *KadParams
+	store  RecordStore
+
+	lock    sync.RWMutex
+	index   map[Address]*NodeRecord
+	Nodes   [][]*NodeRecord // per-bin records, in insertion order
+	cursors []int
+}
+
+func newKadDb(addr Address, params *KadParams) *KadDb {
+	return &KadDb{
+		addr:    addr,
+		params:  params,
+		index:   make(map[Address]*NodeRecord),
+		Nodes:   make([][]*NodeRecord, params.MaxProx+1),
+		cursors: make([]int, params.MaxProx+1),
+	}
+}
+
+// SetStore wires store as the persistence backend for incremental writes
+// on findOrCreate, setSeen and connection state transitions.
+func (self *KadDb) SetStore(store RecordStore) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.store = store
+}
+
+// LoadFromStore hydrates the in-memory index and bins from the currently
+// wired RecordStore, walking every bin via IterateBin. Call it once after
+// SetStore so a restarting node comes up with a warm kaddb of whatever was
+// persisted, rather than rebuilding it from scratch over the network.
+func (self *KadDb) LoadFromStore() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.store == nil {
+		return
+	}
+	for bin := 0; bin <= self.params.MaxProx; bin++ {
+		n := 0
+		self.store.IterateBin(bin, func(record *NodeRecord) bool {
+			if _, found := self.index[record.Addr]; !found {
+				self.index[record.Addr] = record
+				self.Nodes[bin] = append(self.Nodes[bin], record)
+				n++
+			}
+			return self.params.MaxRecordsPerBin == 0 || n < self.params.MaxRecordsPerBin
+		})
+	}
+}
+
+// get returns the record for addr, if one is known.
+func (self *KadDb) get(addr Address) (*NodeRecord, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	record, ok := self.index[addr]
+	return record, ok
+}
+
+// count returns the number of known records, bonded or not.
+func (self *KadDb) count() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return len(self.index)
+}
+
+// firstDisconnected returns the node of the first currently disconnected,
+// previously-seen record in bin, for callers (eg. bond.go's
+// replaceFromDb) that need to re-dial a known peer to top a bucket back
+// up. record.connected and record.node are mutated exclusively through
+// KadDb's own lock (see setConnected/setNode), so they may only be read
+// while holding that lock, as here and in Hive.Records - reading db.Nodes
+// or a record's fields without it is a data race against On/Off.
+func (self *KadDb) firstDisconnected(bin int) (node Node, found bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	for _, r := range self.Nodes[bin] {
+		if r.connected || r.node == nil {
+			continue
+		}
+		return r.node, true
+	}
+	return nil, false
+}
+
+// setNode records the live Node behind a kaddb record, called by
+// Kademlia.On once it has looked the record up via findOrCreate.
+func (self *KadDb) setNode(record *NodeRecord, node Node) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	record.node = node
+}
+
+// nodeOf returns the live Node currently recorded against record, if any.
+func (self *KadDb) nodeOf(record *NodeRecord) Node {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return record.node
+}
+
+// setConnected flips a record's connected state, called by Kademlia.On
+// and Off as a node is promoted into or dropped from the active table.
+func (self *KadDb) setConnected(record *NodeRecord, connected bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	record.connected = connected
+}
+
+// findOrCreate returns the existing record for addr, bumping its lastSeen,
+// or creates and inserts a new one into bin if none exists yet.
+func (self *KadDb) findOrCreate(bin int, addr Address, url string) *NodeRecord {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if record, ok := self.index[addr]; ok {
+		record.setSeen()
+		self.writeThrough(record)
+		return record
+	}
+
+	record := &NodeRecord{Addr: addr, Url: url, LastSeen: time.Now()}
+	self.insert(bin, record)
+	self.writeThrough(record)
+	return record
+}
+
+// add merges nrs into kaddb, binning each by proximityBin(record.Addr) and
+// skipping addresses already known.
+func (self *KadDb) add(nrs []*NodeRecord, proximityBin func(Address) int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, record := range nrs {
+		if _, found := self.index[record.Addr]; found {
+			continue
+		}
+		self.insert(proximityBin(record.Addr), record)
+		self.writeThrough(record)
+	}
+}
+
+// insert adds record to bin, evicting the record with the oldest LastSeen
+// in that bin first if MaxRecordsPerBin would otherwise be exceeded.
+// Caller holds the lock.
+func (self *KadDb) insert(bin int, record *NodeRecord) {
+	self.index[record.Addr] = record
+	bucket := append(self.Nodes[bin], record)
+	if max := self.params.MaxRecordsPerBin; max > 0 && len(bucket) > max {
+		oldest := 0
+		for i, r := range bucket {
+			if r.LastSeen.Before(bucket[oldest].LastSeen) {
+				oldest = i
+			}
+		}
+		evicted := bucket[oldest]
+		bucket = append(bucket[:oldest], bucket[oldest+1:]...)
+		delete(self.index, evicted.Addr)
+		if self.store != nil {
+			self.store.Delete(evicted.Addr)
+		}
+	}
+	self.Nodes[bin] = bucket
+}
+
+// writeThrough persists record via the RecordStore, if one is wired.
+// Caller holds the lock.
+func (self *KadDb) writeThrough(record *NodeRecord) {
+	if self.store != nil {
+		self.store.Put(record)
+	}
+}
+
+// findBest returns the least recently seen, currently disconnected record
+// in the lowest-numbered bin that has one and whose live bucket (as
+// reported by binsize) is not yet full - ie. the best candidate kaddb has
+// for a new connection.
+func (self *KadDb) findBest(bucketSize int, binsize func(int) int) (best *NodeRecord, bin int) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	for i, records := range self.Nodes {
+		if binsize(i) >= bucketSize {
+			continue
+		}
+		for _, record := range records {
+			if record.connected {
+				continue
+			}
+			if best == nil || record.LastSeen.Before(best.LastSeen) {
+				best = record
+				bin = i
+			}
+		}
+		if best != nil {
+			break
+		}
+	}
+	return
+}
+
+// save persists the full kaddb to path in JSON format. This is now mostly
+// an export/import helper: day to day persistence goes through the
+// RecordStore wired via SetStore, written incrementally as records change.
+func (self *KadDb) save(path string, cb func(*NodeRecord, Node)) error {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+
+	var records []*NodeRecord
+	for _, bucket := range self.Nodes {
+		for _, record := range bucket {
+			if cb != nil {
+				cb(record, record.node)
+			}
+			records = append(records, record)
+		}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// load imports a kaddb previously written by save.
+func (self *KadDb) load(path string, cb func(*NodeRecord, Node) error) (err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var records []*NodeRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, record := range records {
+		if cb != nil {
+			if err := cb(record, record.node); err != nil {
+				return err
+			}
+		}
+		bin := proximity(self.addr, record.Addr)
+		if bin > self.params.MaxProx {
+			bin = self.params.MaxProx
+		}
+		self.insert(bin, record)
+		self.writeThrough(record)
+	}
+	return nil
+}
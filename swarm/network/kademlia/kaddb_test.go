@@ -0,0 +1,30 @@
+package kademlia
+
+import "testing"
+
+// TestKadDbEvictsByOldestLastSeen guards against regressing to evicting
+// whichever record happens to be first in insertion order: a record
+// touched most recently must survive over one that was inserted later but
+// seen longer ago.
+func TestKadDbEvictsByOldestLastSeen(t *testing.T) {
+	params := NewKadParams()
+	params.MaxRecordsPerBin = 2
+	db := newKadDb(testAddr(0x00), params)
+
+	bin := 3
+	fresh := db.findOrCreate(bin, testAddr(0x11), "fresh")
+	stale := db.findOrCreate(bin, testAddr(0x10), "stale")
+
+	// touch fresh again so its LastSeen is newer than stale's, even
+	// though fresh was inserted first
+	db.findOrCreate(bin, fresh.Addr, "fresh")
+
+	db.findOrCreate(bin, testAddr(0x12), "third")
+
+	if _, ok := db.index[stale.Addr]; ok {
+		t.Errorf("expected the least recently seen record to be evicted")
+	}
+	if _, ok := db.index[fresh.Addr]; !ok {
+		t.Errorf("expected the most recently seen record to survive eviction")
+	}
+}
@@ -12,10 +12,14 @@ import (
 )
 
 const (
-	bucketSize   = 3
-	proxBinSize  = 4
-	maxProx      = 8
-	connRetryExp = 2
+	bucketSize       = 3
+	proxBinSize      = 4
+	maxProx          = 8
+	connRetryExp     = 2
+	alpha            = 3
+	retries          = 3
+	bondTimeout      = 2 * time.Second
+	maxRecordsPerBin = 10000
 )
 
 var (
@@ -32,6 +36,10 @@ type KadParams struct {
 	PurgeInterval        time.Duration
 	InitialRetryInterval time.Duration
 	ConnRetryExp         int
+	Alpha                int           // concurrency of iterative network lookups
+	Retries              int           // number of retries for a failing lookup query
+	BondTimeout          time.Duration // how long a successful ping is trusted before re-bonding
+	MaxRecordsPerBin     int           // cap on kaddb records kept per proximity bin, 0 means unbounded
 }
 
 func NewKadParams() *KadParams {
@@ -42,19 +50,27 @@ func NewKadParams() *KadParams {
 		PurgeInterval:        purgeInterval,
 		InitialRetryInterval: initialRetryInterval,
 		ConnRetryExp:         connRetryExp,
+		Alpha:                alpha,
+		Retries:              retries,
+		BondTimeout:          bondTimeout,
+		MaxRecordsPerBin:     maxRecordsPerBin,
 	}
 }
 
 // Kademlia is a table of active nodes
 type Kademlia struct {
-	addr       Address      // immutable baseaddress of the table
-	*KadParams              // Kademlia configuration parameters
-	proxLimit  int          // state, the PO of the first row of the most proximate bin
-	proxSize   int          // state, the number of peers in the most proximate bin
-	count      int          // number of active peers (w live connection)
-	buckets    []*bucket    // the actual bins
-	db         *KadDb       // kaddb, node record database
-	lock       sync.RWMutex // mutex to access buckets
+	addr       Address        // immutable baseaddress of the table
+	*KadParams                // Kademlia configuration parameters
+	proxLimit  int            // state, the PO of the first row of the most proximate bin
+	proxSize   int            // state, the number of peers in the most proximate bin
+	count      int            // number of active peers (w live connection)
+	buckets    []*bucket      // the actual bins
+	db         *KadDb         // kaddb, node record database
+	transport  Transport      // network transport used by iterative lookups
+	pinger     Pinger         // liveness check used to bond peers, see bond.go
+	bonds      *bondCache     // recently bonded peers, avoids re-pinging on every On
+	events     *nodeEventFeed // subscribers to topology changes, see events.go
+	lock       sync.RWMutex   // mutex to access buckets
 }
 
 type Node interface {
@@ -81,6 +97,8 @@ func New(addr Address, params *KadParams) *Kademlia {
 		KadParams: params,
 		buckets:   buckets,
 		db:        newKadDb(addr, params),
+		bonds:     newBondCache(),
+		events:    newNodeEventFeed(),
 	}
 }
 
@@ -103,15 +121,33 @@ func (self *Kademlia) DBCount() int {
 
 // On is the entry point called when a new nodes is added
 // unsafe in that node is not checked to be already active node (to be called once)
+// the node is only promoted into the active table once it is bonded, ie.
+// has answered a ping within BondTimeout (see bond.go)
 func (self *Kademlia) On(node Node, cb func(*NodeRecord, Node) error) (err error) {
+	// ping before taking the lock, so a slow/unresponsive peer never holds
+	// up readers of the table
+	bondErr := self.bond(node)
+	if bondErr != nil {
+		glog.V(logger.Debug).Infof("[KΛÐ]: node %v not bonded: %v", node.Addr(), bondErr)
+	}
+
 	defer self.lock.Unlock()
 	self.lock.Lock()
 
 	index := self.proximityBin(node.Addr())
+	// the record is kept in kaddb regardless of bonding outcome - an
+	// unbonded peer still has somewhere to be looked up from later (eg. by
+	// replaceFromDb), it just isn't promoted into the active bucket below
 	record := self.db.findOrCreate(index, node.Addr(), node.Url())
 	// callback on add node
 	// setting the node on the record, set it checked (for connectivity)
-	record.node = node
+	// record.node/.connected are mutated through KadDb's own lock, not
+	// self.lock, since they're also read from there (findBest, Hive.Records)
+	self.db.setNode(record, node)
+
+	if bondErr != nil {
+		return fmt.Errorf("unable to add node %v, not bonded: %v", node.Addr(), bondErr)
+	}
 
 	if cb != nil {
 		err = cb(record, node)
@@ -121,7 +157,7 @@ func (self *Kademlia) On(node Node, cb func(*NodeRecord, Node) error) (err error
 		}
 		glog.V(logger.Info).Infof("[KΛÐ]: add node record %v with node %v", record, node)
 	}
-	record.connected = true
+	self.events.send(NodeEvent{Kind: NodeEventBonded, Node: node, Bin: index})
 
 	// insert in kademlia table of active nodes
 	bucket := self.buckets[index]
@@ -130,10 +166,15 @@ func (self *Kademlia) On(node Node, cb func(*NodeRecord, Node) error) (err error
 	replaced, err := bucket.insert(node)
 	if err != nil {
 		glog.V(logger.Debug).Infof("[KΛÐ]: node %v not needed: %v", node, err)
+		bucketFullCounter(index).Inc(1)
 		return err
 		// no prox adjustment needed
 		// do not change count
 	}
+	// only mark the record connected once it has actually made it into the
+	// bucket - a failed/rejected insert above must not leave a permanently
+	// "connected" record that findBest then refuses to ever retry
+	self.db.setConnected(record, true)
 	if replaced != nil {
 		glog.V(logger.Debug).Infof("[KΛÐ]: node %v replaced by %v ", replaced, node)
 		return
@@ -142,6 +183,9 @@ func (self *Kademlia) On(node Node, cb func(*NodeRecord, Node) error) (err error
 	glog.V(logger.Info).Infof("[KΛÐ]: add node %v to table", node)
 	self.count++
 	self.setProxLimit(index, false)
+	bucketAddCounter(index).Inc(1)
+	self.reportProxMetrics()
+	self.events.send(NodeEvent{Kind: NodeEventAdded, Node: node, Bin: index})
 	return
 }
 
@@ -171,14 +215,21 @@ func (self *Kademlia) Off(node Node, cb func(*NodeRecord, Node)) (err error) {
 	}
 
 	self.setProxLimit(index, true)
+	bucketRemoveCounter(index).Inc(1)
+	self.reportProxMetrics()
 
-	r := self.db.index[node.Addr()]
+	// r.node/.connected are read/written through KadDb's own lock, not
+	// self.lock - see the matching comment in On
+	r, _ := self.db.get(node.Addr())
 	// callback on remove
 	if cb != nil {
-		cb(r, r.node)
+		cb(r, self.db.nodeOf(r))
 	}
-	r.node = nil
-	r.connected = false
+	// keep r.node around (only flip connected) so a later revalidation
+	// eviction can hand this record straight back to On via replaceFromDb,
+	// which only picks records that still have a Node set
+	self.db.setConnected(r, false)
+	self.events.send(NodeEvent{Kind: NodeEventRemoved, Node: node, Bin: index})
 
 	return
 }
@@ -288,6 +339,15 @@ func (self *Kademlia) Add(nrs []*NodeRecord) {
 	self.db.add(nrs, self.proximityBin)
 }
 
+// SetRecordStore wires a RecordStore (e.g. LevelDBStore) that kaddb writes
+// through to incrementally, and immediately hydrates kaddb's in-memory
+// index from whatever the store already has, so a restarting node comes up
+// warm instead of rebuilding its table from scratch. See kaddb.go.
+func (self *Kademlia) SetRecordStore(store RecordStore) {
+	self.db.SetStore(store)
+	self.db.LoadFromStore()
+}
+
 // in situ mutable bucket
 type bucket struct {
 	size  int
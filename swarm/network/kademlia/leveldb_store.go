@@ -0,0 +1,129 @@
+package kademlia
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const (
+	ldbAddrPrefix = "a" // ldbAddrPrefix|addr -> NodeRecord JSON
+	ldbBinPrefix  = "b" // ldbBinPrefix|bin|invLastSeen|addr -> addr
+)
+
+// LevelDBStore is a RecordStore backed by ethdb's LevelDB wrapper. Records
+// are additionally indexed under a bin|lastSeen|addr key so that
+// IterateBin visits a bin's records ordered from most to least recently
+// seen, without having to load and sort the whole bin on every call.
+type LevelDBStore struct {
+	db       *ethdb.LDBDatabase
+	baseAddr Address
+	maxProx  int
+}
+
+// NewLevelDBStore opens (or creates) a LevelDB-backed RecordStore at path.
+// baseAddr and maxProx are the same values the owning Kademlia was created
+// with, and are used to bin incoming records the same way the table does.
+func NewLevelDBStore(path string, baseAddr Address, maxProx int) (*LevelDBStore, error) {
+	db, err := ethdb.NewLDBDatabase(path, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBStore{db: db, baseAddr: baseAddr, maxProx: maxProx}, nil
+}
+
+func (s *LevelDBStore) bin(addr Address) int {
+	bin := proximity(s.baseAddr, addr)
+	if bin > s.maxProx {
+		bin = s.maxProx
+	}
+	return bin
+}
+
+func addrKey(addr Address) []byte {
+	return append([]byte(ldbAddrPrefix), addr.Bytes()...)
+}
+
+func binPrefix(bin int) []byte {
+	key := make([]byte, 0, len(ldbBinPrefix)+4)
+	key = append(key, []byte(ldbBinPrefix)...)
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(bin))
+	return append(key, buf[:]...)
+}
+
+func binKey(bin int, lastSeen time.Time, addr Address) []byte {
+	key := binPrefix(bin)
+	var buf [8]byte
+	// invert so the freshest lastSeen sorts first within the bin
+	binary.BigEndian.PutUint64(buf[:], ^uint64(lastSeen.UnixNano()))
+	key = append(key, buf[:]...)
+	return append(key, addr.Bytes()...)
+}
+
+// Put persists record, replacing any bin-index entry left behind by a
+// previous Put for the same address. Without this, an address that is
+// re-seen (eg. on every On/ping) would leave behind one stale bin|lastSeen
+// key per touch, since that key embeds the now-outdated LastSeen.
+func (s *LevelDBStore) Put(record *NodeRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	batch := s.db.NewBatch()
+	if prev, ok := s.Get(record.Addr); ok {
+		batch.Delete(binKey(s.bin(prev.Addr), prev.LastSeen, prev.Addr))
+	}
+	batch.Put(addrKey(record.Addr), data)
+	batch.Put(binKey(s.bin(record.Addr), record.LastSeen, record.Addr), record.Addr.Bytes())
+	batch.Write()
+}
+
+func (s *LevelDBStore) Get(addr Address) (*NodeRecord, bool) {
+	data, err := s.db.Get(addrKey(addr))
+	if err != nil {
+		return nil, false
+	}
+	record := &NodeRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, false
+	}
+	return record, true
+}
+
+func (s *LevelDBStore) Delete(addr Address) {
+	record, ok := s.Get(addr)
+	if !ok {
+		return
+	}
+	batch := s.db.NewBatch()
+	batch.Delete(addrKey(addr))
+	batch.Delete(binKey(s.bin(addr), record.LastSeen, addr))
+	batch.Write()
+}
+
+// IterateBin calls fn for every record stored under bin, freshest lastSeen
+// first, stopping early if fn returns false.
+func (s *LevelDBStore) IterateBin(bin int, fn func(*NodeRecord) bool) {
+	prefix := binPrefix(bin)
+	it := s.db.NewIterator()
+	defer it.Release()
+	for it.Seek(prefix); it.Valid() && bytes.HasPrefix(it.Key(), prefix); it.Next() {
+		record, ok := s.Get(BytesToAddress(it.Value()))
+		if !ok {
+			continue
+		}
+		if !fn(record) {
+			return
+		}
+	}
+}
+
+// Close releases the underlying LevelDB handle.
+func (s *LevelDBStore) Close() error {
+	s.db.Close()
+	return nil
+}
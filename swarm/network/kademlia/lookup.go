@@ -0,0 +1,279 @@
+package kademlia
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/ethereum/go-ethereum/logger"
+	"github.com/ethereum/go-ethereum/logger/glog"
+)
+
+// Transport abstracts the wire protocol used to ask a remote node for the
+// nodes it knows to be closest to a target address. It is injected so that
+// the iterative lookup can be driven in tests without a live devp2p
+// connection.
+type Transport interface {
+	Query(node Node, target Address) ([]Node, error)
+}
+
+// SetTransport wires the network transport used by IterativeFindNode,
+// IterativeFindValue and Bootstrap. It must be called once before any of
+// them are used.
+func (self *Kademlia) SetTransport(transport Transport) {
+	self.transport = transport
+}
+
+// shortlistEntry tracks the lookup state of a single candidate node.
+type shortlistEntry struct {
+	node     Node
+	queried  bool
+	answered bool
+}
+
+// shortlist is the working set of an iterative lookup: every node seen so
+// far, ordered by proximity to target, together with their query state. It
+// is not trimmed to k entries; closest(k) applies k only to the result.
+type shortlist struct {
+	target  Address
+	entries []*shortlistEntry
+	seen    map[Address]bool
+}
+
+func newShortlist(target Address, known []Node) *shortlist {
+	s := &shortlist{
+		target: target,
+		seen:   make(map[Address]bool),
+	}
+	for _, n := range known {
+		s.insert(n)
+	}
+	return s
+}
+
+// insert adds node to the shortlist keeping it ordered by ProxCmp to
+// target. It returns true if the node is closer than the current closest
+// entry, which the caller uses to detect lookup progress.
+func (s *shortlist) insert(node Node) bool {
+	if s.seen[node.Addr()] {
+		return false
+	}
+	s.seen[node.Addr()] = true
+
+	ix := 0
+	for ix < len(s.entries) && s.target.ProxCmp(s.entries[ix].node.Addr(), node.Addr()) < 0 {
+		ix++
+	}
+	entry := &shortlistEntry{node: node}
+	s.entries = append(s.entries, nil)
+	copy(s.entries[ix+1:], s.entries[ix:])
+	s.entries[ix] = entry
+	return ix == 0
+}
+
+// next returns up to alpha un-queried entries, closest to target first, and
+// marks them as queried.
+func (s *shortlist) next(alpha int) []*shortlistEntry {
+	var batch []*shortlistEntry
+	for _, e := range s.entries {
+		if len(batch) == alpha {
+			break
+		}
+		if !e.queried {
+			e.queried = true
+			batch = append(batch, e)
+		}
+	}
+	return batch
+}
+
+// retry clears the queried flag on addr so it is picked up again by next.
+func (s *shortlist) retry(addr Address) {
+	for _, e := range s.entries {
+		if e.node.Addr() == addr {
+			e.queried = false
+			return
+		}
+	}
+}
+
+func (s *shortlist) markAnswered(addr Address) {
+	for _, e := range s.entries {
+		if e.node.Addr() == addr {
+			e.answered = true
+			return
+		}
+	}
+}
+
+func (s *shortlist) answeredCount() (n int) {
+	for _, e := range s.entries {
+		if e.answered {
+			n++
+		}
+	}
+	return n
+}
+
+// closest returns up to k nodes of the shortlist that actually answered a
+// query, closest to target first.
+func (s *shortlist) closest(k int) []Node {
+	var nodes []Node
+	for _, e := range s.entries {
+		if !e.answered {
+			continue
+		}
+		nodes = append(nodes, e.node)
+		if len(nodes) == k {
+			break
+		}
+	}
+	return nodes
+}
+
+// lookupRound fires one round of the iterative walk: it queries the Alpha
+// closest un-queried entries of list in parallel through the transport set
+// by SetTransport, merges every response into list and feeds newly
+// discovered nodes back into the routing table via On. A failing query is
+// retried, within the same round, up to KadParams.Retries times per node
+// over the whole walk (counted in failures). If onNode is non-nil it is called
+// for every node a query returns, and a true result short-circuits the
+// round, returning that node as found. It reports whether the round made
+// progress (found a node closer than the shortlist's previous best) and
+// whether the walk is done (no more un-queried candidates, ctx was
+// cancelled, or onNode matched).
+func (self *Kademlia) lookupRound(ctx context.Context, target Address, list *shortlist, alpha int, failures map[Address]int, onNode func(Node) bool) (progressed bool, found Node, done bool, err error) {
+	batch := list.next(alpha)
+	if len(batch) == 0 {
+		return false, nil, true, nil
+	}
+
+	type response struct {
+		entry *shortlistEntry
+		nodes []Node
+		err   error
+	}
+	results := make(chan response, len(batch))
+	var wg sync.WaitGroup
+	for _, entry := range batch {
+		wg.Add(1)
+		go func(entry *shortlistEntry) {
+			defer wg.Done()
+			nodes, qerr := self.transport.Query(entry.node, target)
+			results <- response{entry, nodes, qerr}
+		}(entry)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		addr := res.entry.node.Addr()
+		for res.err != nil && failures[addr] < self.Retries {
+			failures[addr]++
+			res.nodes, res.err = self.transport.Query(res.entry.node, target)
+		}
+		if res.err != nil {
+			glog.V(logger.Detail).Infof("[KΛÐ]: lookup query to %v failed: %v", addr, res.err)
+			continue
+		}
+		list.markAnswered(addr)
+		for _, n := range res.nodes {
+			self.On(n, nil)
+			if onNode != nil && onNode(n) {
+				return false, n, true, nil
+			}
+			if list.insert(n) {
+				progressed = true
+			}
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return progressed, nil, true, ctx.Err()
+	default:
+	}
+
+	return progressed, nil, false, nil
+}
+
+// IterativeFindNode walks the network towards target, starting from the
+// locally known closest nodes, round by round via lookupRound. The walk
+// terminates when a full round of queries fails to surface a node closer
+// than the current closest, or when k nodes have responded, whichever
+// comes first. It returns the k closest responsive nodes found.
+func (self *Kademlia) IterativeFindNode(ctx context.Context, target Address, k int) ([]Node, error) {
+	if self.transport == nil {
+		return nil, fmt.Errorf("kademlia: no transport set")
+	}
+	alpha := self.Alpha
+	if alpha == 0 {
+		alpha = 3
+	}
+
+	list := newShortlist(target, self.FindClosest(target, k))
+	failures := make(map[Address]int)
+
+	for {
+		progressed, _, done, err := self.lookupRound(ctx, target, list, alpha, failures, nil)
+		if err != nil {
+			return list.closest(k), err
+		}
+		if done || !progressed || list.answeredCount() >= k {
+			break
+		}
+	}
+
+	return list.closest(k), nil
+}
+
+// IterativeFindValue performs the same round-by-round walk as
+// IterativeFindNode via lookupRound, but stops as soon as a query response
+// contains a node whose address is target, in which case that node is
+// returned alongside the shortlist accumulated so far.
+func (self *Kademlia) IterativeFindValue(ctx context.Context, target Address, k int) (Node, []Node, error) {
+	if self.transport == nil {
+		return nil, nil, fmt.Errorf("kademlia: no transport set")
+	}
+	alpha := self.Alpha
+	if alpha == 0 {
+		alpha = 3
+	}
+
+	list := newShortlist(target, self.FindClosest(target, k))
+	failures := make(map[Address]int)
+
+	for {
+		progressed, found, done, err := self.lookupRound(ctx, target, list, alpha, failures, func(n Node) bool {
+			return n.Addr() == target
+		})
+		if found != nil {
+			return found, list.closest(k), nil
+		}
+		if err != nil {
+			return nil, list.closest(k), err
+		}
+		if done || !progressed || list.answeredCount() >= k {
+			break
+		}
+	}
+
+	return nil, list.closest(k), nil
+}
+
+// Bootstrap seeds the routing table with seeds and then runs an iterative
+// lookup for the local address, populating the buckets with whatever the
+// network returns along the way. It is meant to be called once on startup.
+func (self *Kademlia) Bootstrap(ctx context.Context, seeds []Node) error {
+	if self.transport == nil {
+		return fmt.Errorf("kademlia: no transport set")
+	}
+	for _, seed := range seeds {
+		self.On(seed, nil)
+	}
+	_, err := self.IterativeFindNode(ctx, self.addr, self.BucketSize)
+	return err
+}
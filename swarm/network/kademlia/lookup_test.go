@@ -0,0 +1,130 @@
+package kademlia
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeNode is a minimal Node used to drive lookup.go/bond.go without a live
+// devp2p connection.
+type fakeNode struct {
+	addr Address
+	url  string
+}
+
+func (n *fakeNode) Addr() Address         { return n.addr }
+func (n *fakeNode) Url() string           { return n.url }
+func (n *fakeNode) LastActive() time.Time { return time.Now() }
+func (n *fakeNode) Drop()                 {}
+
+func testAddr(b byte) Address {
+	var addr Address
+	addr[0] = b
+	return addr
+}
+
+// fakeTransport answers a fixed, pre-wired set of FindNode responses keyed
+// by the queried node's address.
+type fakeTransport struct {
+	responses map[Address][]Node
+	errors    map[Address]error
+}
+
+func (t *fakeTransport) Query(node Node, target Address) ([]Node, error) {
+	if err, ok := t.errors[node.Addr()]; ok {
+		return nil, err
+	}
+	return t.responses[node.Addr()], nil
+}
+
+func TestIterativeFindNodeDiscoversCloserNode(t *testing.T) {
+	base := testAddr(0x00)
+	target := testAddr(0xff)
+	seed := &fakeNode{addr: testAddr(0x80), url: "seed"}
+	closer := &fakeNode{addr: testAddr(0xf0), url: "closer"}
+
+	kad := New(base, NewKadParams())
+	kad.SetTransport(&fakeTransport{
+		responses: map[Address][]Node{
+			seed.addr:   {closer},
+			closer.addr: {},
+		},
+	})
+	if err := kad.On(seed, nil); err != nil {
+		t.Fatalf("On(seed): %v", err)
+	}
+
+	nodes, err := kad.IterativeFindNode(context.Background(), target, 2)
+	if err != nil {
+		t.Fatalf("IterativeFindNode: %v", err)
+	}
+
+	var foundCloser bool
+	for _, n := range nodes {
+		if n.Addr().String() == closer.addr.String() {
+			foundCloser = true
+		}
+	}
+	if !foundCloser {
+		t.Errorf("expected %v to be discovered via the seed, got %v", closer.addr, nodes)
+	}
+}
+
+func TestIterativeFindNodeRetriesFailingQuery(t *testing.T) {
+	base := testAddr(0x00)
+	target := testAddr(0xff)
+	seed := &fakeNode{addr: testAddr(0x80), url: "seed"}
+
+	params := NewKadParams()
+	params.Retries = 2
+	kad := New(base, params)
+	kad.SetTransport(&fakeTransport{
+		errors: map[Address]error{seed.addr: errTimeout},
+	})
+	if err := kad.On(seed, nil); err != nil {
+		t.Fatalf("On(seed): %v", err)
+	}
+
+	// a permanently failing transport must still terminate the walk
+	// rather than retrying forever
+	nodes, err := kad.IterativeFindNode(context.Background(), target, 2)
+	if err != nil {
+		t.Fatalf("IterativeFindNode: %v", err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("expected no responsive nodes, got %v", nodes)
+	}
+}
+
+func TestIterativeFindValueFindsTarget(t *testing.T) {
+	base := testAddr(0x00)
+	target := testAddr(0xff)
+	seed := &fakeNode{addr: testAddr(0x80), url: "seed"}
+	holder := &fakeNode{addr: target, url: "holder"}
+
+	kad := New(base, NewKadParams())
+	kad.SetTransport(&fakeTransport{
+		responses: map[Address][]Node{
+			seed.addr: {holder},
+		},
+	})
+	if err := kad.On(seed, nil); err != nil {
+		t.Fatalf("On(seed): %v", err)
+	}
+
+	found, _, err := kad.IterativeFindValue(context.Background(), target, 2)
+	if err != nil {
+		t.Fatalf("IterativeFindValue: %v", err)
+	}
+	if found == nil || found.Addr().String() != target.String() {
+		t.Errorf("expected to find the target node, got %v", found)
+	}
+}
+
+var errTimeout = fakeErr("query timed out")
+
+type fakeErr string
+
+func (e fakeErr) Error() string { return string(e) }
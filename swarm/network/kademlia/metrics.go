@@ -0,0 +1,32 @@
+package kademlia
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	metricsProxLimit = metrics.NewRegisteredGauge("kademlia/proxLimit", nil)
+	metricsProxSize  = metrics.NewRegisteredGauge("kademlia/proxSize", nil)
+	metricsCount     = metrics.NewRegisteredGauge("kademlia/count", nil)
+)
+
+func bucketAddCounter(bin int) metrics.Counter {
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("kademlia/bucket/add/%d", bin), nil)
+}
+
+func bucketRemoveCounter(bin int) metrics.Counter {
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("kademlia/bucket/remove/%d", bin), nil)
+}
+
+func bucketFullCounter(bin int) metrics.Counter {
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("kademlia/bucket/full/%d", bin), nil)
+}
+
+// reportProxMetrics updates the table-wide gauges. Caller holds self.lock.
+func (self *Kademlia) reportProxMetrics() {
+	metricsProxLimit.Update(int64(self.proxLimit))
+	metricsProxSize.Update(int64(self.proxSize))
+	metricsCount.Update(int64(self.count))
+}